@@ -6,18 +6,18 @@ import (
 	"encore.app/user"
 	"encore.dev/beta/auth"
 	"encore.dev/beta/errs"
-	"github.com/google/uuid"
 )
 
-// Data is the auth data
-type Data struct {
-	Email string
+// Params are the inputs to AuthHandler: the bearer token.
+type Params struct {
+	Authorization string `header:"Authorization"`
 }
 
 // AuthHandler handle auth information
 //
 //encore:authhandler
-func AuthHandler(ctx context.Context, token string) (auth.UID, *Data, error) {
+func AuthHandler(ctx context.Context, p *Params) (auth.UID, *user.AuthData, error) {
+	token := bearerToken(p.Authorization)
 	if token == "" {
 		return "", nil, &errs.Error{
 			Code:    errs.Unauthenticated,
@@ -31,5 +31,15 @@ func AuthHandler(ctx context.Context, token string) (auth.UID, *Data, error) {
 			Message: "invalid token",
 		}
 	}
-	return auth.UID(uuid.New().String()), &Data{Email: resp.Email}, nil
+
+	return auth.UID(resp.UserID), &user.AuthData{Email: resp.Email}, nil
+}
+
+// bearerToken strips the "Bearer " prefix from an Authorization header value, if present.
+func bearerToken(authorization string) string {
+	const prefix = "Bearer "
+	if len(authorization) > len(prefix) && authorization[:len(prefix)] == prefix {
+		return authorization[len(prefix):]
+	}
+	return authorization
 }
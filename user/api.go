@@ -2,11 +2,12 @@ package user
 
 import (
 	"context"
-	"regexp"
 
 	"encore.app/user/security"
+	"encore.app/user/types"
 	"encore.dev/beta/errs"
 	"encore.dev/pubsub"
+	"encore.dev/rlog"
 	"encore.dev/storage/sqldb"
 )
 
@@ -24,6 +25,12 @@ func initAPI() (*API, error) {
 	return &API{Service: NewService(db)}, nil
 }
 
+// AuthData is the auth data returned by authentication.AuthHandler for every authenticated
+// request, made available to handlers in this service via auth.Data().
+type AuthData struct {
+	Email string
+}
+
 // AuthEvent are the parameters to the AuthEvent
 type AuthEvent struct {
 	UserEmail string
@@ -36,16 +43,21 @@ var AuthEvents = pubsub.NewTopic[*AuthEvent]("auth", pubsub.TopicConfig{
 
 // AuthParams are the parameters to the Auth method
 type AuthParams struct {
-	Email    string `json:"email"`
-	Password string `json:"password"`
+	Email     types.Email `json:"email"`
+	Password  string      `json:"password"`
+	UserAgent string      `header:"User-Agent"`
 }
 
-// AuthResponse is the response to the Auth method
+// AuthResponse is the response to the Auth method. Either Token is set, or MFARequired is true
+// and ChallengeToken must be passed to AuthTOTP to complete the login.
 type AuthResponse struct {
-	Token string `json:"token"`
+	Token          string `json:"token,omitempty"`
+	MFARequired    bool   `json:"mfa_required,omitempty"`
+	ChallengeToken string `json:"challenge_token,omitempty"`
 }
 
-// Auth authenticates a user and returns a token
+// Auth authenticates a user and returns a token, or, if the user has TOTP enrolled, a short-lived
+// challenge token to be completed via AuthTOTP
 //
 //encore:api public method=POST path=/v1/auth
 func (a *API) Auth(ctx context.Context, p *AuthParams) (*AuthResponse, error) {
@@ -56,18 +68,46 @@ func (a *API) Auth(ctx context.Context, p *AuthParams) (*AuthResponse, error) {
 	if err != nil {
 		return nil, eb.Code(errs.Unauthenticated).Msg("invalid credentials").Err()
 	}
+
+	hasTOTP, err := a.Service.HasConfirmedTOTP(ctx, p.Email.String())
+	if err != nil {
+		return nil, eb.Code(errs.Internal).Msg("internal error").Err()
+	}
+	if hasTOTP {
+		challenge, err := security.NewChallengeToken(p.Email.String())
+		if err != nil {
+			return nil, eb.Code(errs.Internal).Msg("internal error").Err()
+		}
+		return &AuthResponse{MFARequired: true, ChallengeToken: challenge}, nil
+	}
+
 	var response AuthResponse
-	response.Token, err = security.NewToken(p.Email)
+	response.Token, err = security.NewToken(p.Email.String())
 	if err != nil {
 		return nil, eb.Code(errs.Internal).Msg("internal error").Err()
 	}
-	_, err = AuthEvents.Publish(ctx, &AuthEvent{UserEmail: p.Email})
+	_, err = AuthEvents.Publish(ctx, &AuthEvent{UserEmail: p.Email.String()})
 	if err != nil {
 		return nil, eb.Code(errs.Internal).Msg("internal error").Err()
 	}
+	publishUserLoggedIn(ctx, a.Service, p.Email.String(), p.UserAgent)
 	return &response, nil
 }
 
+// publishUserLoggedIn publishes a UserLoggedInEvent for a successful login. Unlike credential
+// validation, a failure to resolve the actor or publish the event doesn't affect the caller who
+// already authenticated, so it's logged rather than surfaced as a request error.
+func publishUserLoggedIn(ctx context.Context, svc UseCase, email, userAgent string) {
+	actor, err := svc.AuditActor(ctx, email)
+	if err != nil {
+		rlog.Error("could not resolve audit actor for login event", "err", err)
+		return
+	}
+	if _, err := UserLoggedInEvents.Publish(ctx, &UserLoggedInEvent{UID: actor.UID, UserAgent: userAgent}); err != nil {
+		rlog.Error("could not publish user logged in event", "err", err)
+	}
+}
+
 // ValidateTokenParams are the parameters to the ValidateToken method
 type ValidateTokenParams struct {
 	Token string `json:"token"`
@@ -75,7 +115,8 @@ type ValidateTokenParams struct {
 
 // ValidateTokenResponse is the response to the ValidateToken method
 type ValidateTokenResponse struct {
-	Email string `json:"email"`
+	Email  string `json:"email"`
+	UserID string `json:"user_id"`
 }
 
 // ValidateToken validates a token
@@ -92,18 +133,44 @@ func (a *API) ValidateToken(ctx context.Context, p *ValidateTokenParams) (*Valid
 	if err != nil {
 		return nil, eb.Code(errs.Internal).Msg("internal error").Err()
 	}
+	if tData["purpose"] != nil {
+		// Reject special-purpose tokens (e.g. the MFA challenge or OAuth state token) as session
+		// bearer tokens.
+		return nil, eb.Code(errs.Unauthenticated).Msg("invalid token").Err()
+	}
+	email, ok := tData["email"].(string)
+	if !ok || email == "" {
+		return nil, eb.Code(errs.Unauthenticated).Msg("invalid token").Err()
+	}
+
+	iat, _ := tData["iat"].(float64)
+	valid, err := a.Service.IsTokenValidForEmail(ctx, email, int64(iat))
+	if err != nil {
+		return nil, eb.Code(errs.Internal).Msg("internal error").Err()
+	}
+	if !valid {
+		// The password was changed after this token was issued.
+		return nil, eb.Code(errs.Unauthenticated).Msg("invalid token").Err()
+	}
+
+	actor, err := a.Service.AuditActor(ctx, email)
+	if err != nil {
+		return nil, eb.Code(errs.Internal).Msg("internal error").Err()
+	}
+
 	response := ValidateTokenResponse{
-		Email: tData["email"].(string),
+		Email:  email,
+		UserID: actor.UID,
 	}
 	return &response, nil
 }
 
 // CreateUserParams are the parameters to the CreateUser method
 type CreateUserParams struct {
-	Email     string `json:"email"`
-	Password  string `json:"password"`
-	FirstName string `json:"first_name"`
-	LastName  string `json:"last_name"`
+	Email     types.Email `json:"email"`
+	Password  string      `json:"password"`
+	FirstName string      `json:"first_name"`
+	LastName  string      `json:"last_name"`
 }
 
 // CreateUserResponse is the response to the CreateUser method
@@ -118,11 +185,6 @@ func (a *API) CreateUser(ctx context.Context, p *CreateUserParams) (*CreateUserR
 	// Construct a new error builder with errs.B()
 	eb := errs.B().Meta("create_user", p.Email)
 
-	// Validate email format
-	if !isValidEmail(p.Email) {
-		return nil, eb.Code(errs.InvalidArgument).Msg("invalid email format").Err()
-	}
-
 	// Check if email already exists
 	exists, err := a.Service.UserExists(ctx, p.Email)
 	if err != nil {
@@ -140,22 +202,16 @@ func (a *API) CreateUser(ctx context.Context, p *CreateUserParams) (*CreateUserR
 
 	// Generate token
 	var response CreateUserResponse
-	response.Token, err = security.NewToken(p.Email)
+	response.Token, err = security.NewToken(p.Email.String())
 	if err != nil {
 		return nil, eb.Code(errs.Internal).Msg("internal error").Err()
 	}
 
 	// Publish auth event
-	_, err = AuthEvents.Publish(ctx, &AuthEvent{UserEmail: p.Email})
+	_, err = AuthEvents.Publish(ctx, &AuthEvent{UserEmail: p.Email.String()})
 	if err != nil {
 		return nil, eb.Code(errs.Internal).Msg("internal error").Err()
 	}
 
 	return &response, nil
 }
-
-// isValidEmail validates the email format
-func isValidEmail(email string) bool {
-	re := regexp.MustCompile(`^[a-zA-Z0-9._%+-]+@[a-zA-Z0-9.-]+\.[a-zA-Z]{2,}$`)
-	return re.MatchString(email)
-}
@@ -0,0 +1,36 @@
+package user
+
+import (
+	"context"
+	"fmt"
+
+	"encore.dev/pubsub"
+)
+
+// AuditActor is the canonical {uid, email} pair downstream services should log for an
+// authenticated request, so audit trails stay consistent across the codebase.
+type AuditActor struct {
+	UID   string
+	Email string
+}
+
+// AuditActor resolves the canonical AuditActor for email.
+func (s *Service) AuditActor(ctx context.Context, email string) (*AuditActor, error) {
+	userID, err := s.userIDByEmail(ctx, email)
+	if err != nil {
+		return nil, fmt.Errorf("could not resolve audit actor: %w", err)
+	}
+	return &AuditActor{UID: userID, Email: email}, nil
+}
+
+// UserLoggedInEvent is published whenever a login succeeds (Auth, AuthTOTP, OAuthCallback), for
+// session and audit tracking.
+type UserLoggedInEvent struct {
+	UID       string
+	UserAgent string
+}
+
+// UserLoggedInEvents topic
+var UserLoggedInEvents = pubsub.NewTopic[*UserLoggedInEvent]("user-logged-in", pubsub.TopicConfig{
+	DeliveryGuarantee: pubsub.AtLeastOnce,
+})
@@ -0,0 +1,39 @@
+package user
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"encore.app/user/types"
+	"github.com/google/uuid"
+)
+
+// TestAuditActor_ResolvesStableUID confirms AuditActor resolves the same database-backed UID
+// for a user across calls, which is what makes it usable for audit correlation in the first
+// place (unlike the random-per-request UID this replaced).
+func TestAuditActor_ResolvesStableUID(t *testing.T) {
+	ctx := context.Background()
+	s := NewService(db)
+
+	email, _ := types.NewEmail(fmt.Sprintf("audit-%s@example.com", uuid.New().String()))
+	if err := s.CreateUser(ctx, email, "hunter2-hunter2", "Test", "User"); err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+
+	first, err := s.AuditActor(ctx, email.String())
+	if err != nil {
+		t.Fatalf("AuditActor: %v", err)
+	}
+	if first.UID == "" || first.Email != email.String() {
+		t.Fatalf("AuditActor = %+v, want a non-empty UID and matching email", first)
+	}
+
+	second, err := s.AuditActor(ctx, email.String())
+	if err != nil {
+		t.Fatalf("AuditActor (second call): %v", err)
+	}
+	if second.UID != first.UID {
+		t.Fatalf("AuditActor returned different UIDs for the same user: %q vs %q", first.UID, second.UID)
+	}
+}
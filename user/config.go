@@ -0,0 +1,22 @@
+package user
+
+import "encore.dev/config"
+
+// Config is the per-environment configuration for the user service.
+type Config struct {
+	// PasswordAlgorithm selects the PasswordHasher used for newly hashed passwords:
+	// "bcrypt" (default) or "argon2id".
+	PasswordAlgorithm config.String
+	// BcryptCost is the bcrypt cost factor used when PasswordAlgorithm is "bcrypt". Zero uses
+	// bcrypt.DefaultCost.
+	BcryptCost config.Int
+	// GoogleOAuthRedirectAllowlist lists the exact redirect_uri values OAuthLogin and
+	// OAuthCallback accept for the google provider. A caller-supplied redirect_uri not in this
+	// list is rejected before it's ever sent to Google, rather than relying solely on Google's
+	// own client-registration check.
+	GoogleOAuthRedirectAllowlist config.Values[string]
+	// GitHubOAuthRedirectAllowlist is the equivalent allowlist for the github provider.
+	GitHubOAuthRedirectAllowlist config.Values[string]
+}
+
+var cfg = config.Load[Config]()
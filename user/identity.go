@@ -0,0 +1,69 @@
+package user
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"encore.app/user/types"
+	"github.com/google/uuid"
+)
+
+// LinkOrCreateIdentity resolves an external identity to a monetz user: if the identity is
+// already linked it returns the linked user's email, otherwise it links to an existing user
+// found by email or auto-provisions a new one. email is normalized to its canonical form before
+// any lookup or write, so provider-supplied casing can't miss an existing row or trip the
+// users_email_lower unique index.
+func (s *Service) LinkOrCreateIdentity(ctx context.Context, provider, subject, rawEmail string) (types.Email, error) {
+	email, err := types.NewEmail(rawEmail)
+	if err != nil {
+		return "", fmt.Errorf("invalid email from provider: %w", err)
+	}
+
+	var linkedEmail string
+	err = s.DB.QueryRow(ctx, `
+        select u.email from user_identities ui
+        join users u on u.id = ui.user_id
+        where ui.provider = $1 and ui.subject = $2
+    `, provider, subject).Scan(&linkedEmail)
+	if err == nil {
+		return types.Email(linkedEmail), nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return "", fmt.Errorf("could not look up identity: %w", err)
+	}
+
+	tx, err := s.DB.Begin(ctx)
+	if err != nil {
+		return "", fmt.Errorf("could not start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var userID string
+	err = tx.QueryRow(ctx, `select id from users where email = $1`, email.String()).Scan(&userID)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		userID = uuid.New().String()
+		_, err = tx.Exec(ctx, `
+            insert into users (id, email, password, first_name, last_name) values ($1, $2, $3, '', '')
+        `, userID, email.String(), "oauth:"+provider)
+		if err != nil {
+			return "", fmt.Errorf("could not create user: %w", err)
+		}
+	case err != nil:
+		return "", fmt.Errorf("could not look up user: %w", err)
+	}
+
+	_, err = tx.Exec(ctx, `
+        insert into user_identities (id, user_id, provider, subject, email) values ($1, $2, $3, $4, $5)
+    `, uuid.New().String(), userID, provider, subject, email.String())
+	if err != nil {
+		return "", fmt.Errorf("could not link identity: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return "", fmt.Errorf("could not commit transaction: %w", err)
+	}
+	return email, nil
+}
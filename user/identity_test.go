@@ -0,0 +1,63 @@
+package user
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"encore.app/user/types"
+	"github.com/google/uuid"
+)
+
+// TestLinkOrCreateIdentity_LinkVsCreate exercises the three branches LinkOrCreateIdentity
+// chooses between: auto-provisioning a new user when neither the identity nor the email is
+// known, linking to an existing user found by email, and returning the already-linked user on
+// a repeat callback for the same identity without creating a second account.
+func TestLinkOrCreateIdentity_LinkVsCreate(t *testing.T) {
+	ctx := context.Background()
+	s := NewService(db)
+	provider := "google"
+	subject := uuid.New().String()
+	email := fmt.Sprintf("oauth-new-%s@example.com", uuid.New().String())
+
+	got, err := s.LinkOrCreateIdentity(ctx, provider, subject, email)
+	if err != nil {
+		t.Fatalf("LinkOrCreateIdentity (create): %v", err)
+	}
+	wantEmail, _ := types.NewEmail(email)
+	if got != wantEmail {
+		t.Fatalf("LinkOrCreateIdentity (create) = %q, want %q", got, wantEmail)
+	}
+	exists, err := s.UserExists(ctx, wantEmail)
+	if err != nil {
+		t.Fatalf("UserExists: %v", err)
+	}
+	if !exists {
+		t.Fatal("LinkOrCreateIdentity (create) did not provision a user")
+	}
+
+	// A repeat callback for the same provider/subject must return the same linked user rather
+	// than creating a second one, even if the provider now reports a different email.
+	got, err = s.LinkOrCreateIdentity(ctx, provider, subject, "changed-"+email)
+	if err != nil {
+		t.Fatalf("LinkOrCreateIdentity (relink): %v", err)
+	}
+	if got != wantEmail {
+		t.Fatalf("LinkOrCreateIdentity (relink) = %q, want the originally linked %q", got, wantEmail)
+	}
+
+	// A new identity whose email matches an existing user links to that user instead of
+	// provisioning a duplicate account.
+	existingEmail := fmt.Sprintf("existing-%s@example.com", uuid.New().String())
+	existing, _ := types.NewEmail(existingEmail)
+	if err := s.CreateUser(ctx, existing, "hunter2-hunter2", "Existing", "User"); err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	got, err = s.LinkOrCreateIdentity(ctx, "github", uuid.New().String(), existingEmail)
+	if err != nil {
+		t.Fatalf("LinkOrCreateIdentity (link to existing): %v", err)
+	}
+	if got != existing {
+		t.Fatalf("LinkOrCreateIdentity (link to existing) = %q, want %q", got, existing)
+	}
+}
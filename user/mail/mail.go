@@ -0,0 +1,9 @@
+// Package mail provides outbound transactional email for the user service.
+package mail
+
+import "context"
+
+// Mailer sends transactional email on behalf of the user service.
+type Mailer interface {
+	SendPasswordReset(ctx context.Context, toEmail, token string) error
+}
@@ -0,0 +1,20 @@
+package mail
+
+import (
+	"context"
+
+	"encore.dev/rlog"
+)
+
+// noopMailer logs the email instead of sending it, for local development.
+type noopMailer struct{}
+
+// NewNoopMailer returns a Mailer that logs instead of sending, for local development.
+func NewNoopMailer() Mailer {
+	return &noopMailer{}
+}
+
+func (m *noopMailer) SendPasswordReset(ctx context.Context, toEmail, token string) error {
+	rlog.Info("password reset email (dev mailer, not sent)", "email", toEmail, "token", token)
+	return nil
+}
@@ -0,0 +1,21 @@
+package mail
+
+import "encore.dev"
+
+// smtpSecrets holds the SMTP relay credentials, configured through Encore secrets.
+var smtpSecrets struct {
+	SMTPHost     string
+	SMTPPort     string
+	SMTPUsername string
+	SMTPPassword string
+	SMTPFrom     string
+}
+
+// New returns the Mailer appropriate for the current Encore environment: a real SMTP mailer in
+// deployed environments, and a no-op mailer that just logs locally.
+func New() Mailer {
+	if encore.Meta().Environment.Type == encore.EnvLocal {
+		return NewNoopMailer()
+	}
+	return NewSMTPMailer(smtpSecrets.SMTPHost, smtpSecrets.SMTPPort, smtpSecrets.SMTPUsername, smtpSecrets.SMTPPassword, smtpSecrets.SMTPFrom)
+}
@@ -0,0 +1,39 @@
+package mail
+
+import (
+	"context"
+	"fmt"
+	"net/smtp"
+)
+
+// smtpConfig holds SMTP connection details, configured through Encore secrets.
+type smtpConfig struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	From     string
+}
+
+// smtpMailer sends email through an SMTP relay.
+type smtpMailer struct {
+	cfg smtpConfig
+}
+
+// NewSMTPMailer returns a Mailer that delivers through the given SMTP relay.
+func NewSMTPMailer(host, port, username, password, from string) Mailer {
+	return &smtpMailer{cfg: smtpConfig{Host: host, Port: port, Username: username, Password: password, From: from}}
+}
+
+func (m *smtpMailer) SendPasswordReset(ctx context.Context, toEmail, token string) error {
+	subject := "Reset your Monetz password"
+	body := fmt.Sprintf("Use the following token to reset your password: %s\n\nIf you didn't request this, you can ignore this email.", token)
+	msg := fmt.Sprintf("From: %s\r\nTo: %s\r\nSubject: %s\r\n\r\n%s\r\n", m.cfg.From, toEmail, subject, body)
+
+	auth := smtp.PlainAuth("", m.cfg.Username, m.cfg.Password, m.cfg.Host)
+	addr := fmt.Sprintf("%s:%s", m.cfg.Host, m.cfg.Port)
+	if err := smtp.SendMail(addr, auth, m.cfg.From, []string{toEmail}, []byte(msg)); err != nil {
+		return fmt.Errorf("could not send password reset email: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,343 @@
+package user
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"encore.app/user/security"
+	"encore.dev/beta/errs"
+)
+
+// oauthSecrets holds the per-provider OAuth client credentials, configured through Encore
+// secrets (`encore secret set --type prod,dev,local GoogleClientSecret ...`).
+var oauthSecrets struct {
+	GoogleClientID     string
+	GoogleClientSecret string
+	GitHubClientID     string
+	GitHubClientSecret string
+}
+
+// OAuthProvider identifies a supported external identity provider.
+type OAuthProvider string
+
+// Supported OAuth providers.
+const (
+	OAuthProviderGoogle OAuthProvider = "google"
+	OAuthProviderGitHub OAuthProvider = "github"
+)
+
+type oauthEndpoint struct {
+	authURL     string
+	tokenURL    string
+	userInfoURL string
+	scope       string
+}
+
+var oauthEndpoints = map[OAuthProvider]oauthEndpoint{
+	OAuthProviderGoogle: {
+		authURL:     "https://accounts.google.com/o/oauth2/v2/auth",
+		tokenURL:    "https://oauth2.googleapis.com/token",
+		userInfoURL: "https://www.googleapis.com/oauth2/v3/userinfo",
+		scope:       "openid email profile",
+	},
+	OAuthProviderGitHub: {
+		authURL:     "https://github.com/login/oauth/authorize",
+		tokenURL:    "https://github.com/login/oauth/access_token",
+		userInfoURL: "https://api.github.com/user",
+		scope:       "read:user user:email",
+	},
+}
+
+func oauthClientCredentials(p OAuthProvider) (clientID, clientSecret string) {
+	switch p {
+	case OAuthProviderGoogle:
+		return oauthSecrets.GoogleClientID, oauthSecrets.GoogleClientSecret
+	case OAuthProviderGitHub:
+		return oauthSecrets.GitHubClientID, oauthSecrets.GitHubClientSecret
+	default:
+		return "", ""
+	}
+}
+
+// redirectURIAllowed reports whether redirectURI is configured for provider. Checked before
+// building the authorize URL and again before exchanging the code, so a caller can't steer
+// either step to an arbitrary redirect_uri in the hope that the provider's own check is lax or
+// misconfigured.
+func redirectURIAllowed(p OAuthProvider, redirectURI string) bool {
+	var allowlist []string
+	switch p {
+	case OAuthProviderGoogle:
+		allowlist = cfg.GoogleOAuthRedirectAllowlist()
+	case OAuthProviderGitHub:
+		allowlist = cfg.GitHubOAuthRedirectAllowlist()
+	}
+	for _, u := range allowlist {
+		if u == redirectURI {
+			return true
+		}
+	}
+	return false
+}
+
+// OAuthLoginParams are the parameters to the OAuthLogin method
+type OAuthLoginParams struct {
+	Provider    OAuthProvider `json:"provider"`
+	RedirectURI string        `json:"redirect_uri"`
+}
+
+// OAuthRedirectResponse is the response to the OAuthLogin method
+type OAuthRedirectResponse struct {
+	AuthorizeURL string `json:"authorize_url"`
+	State        string `json:"state"`
+}
+
+// OAuthLogin returns the provider's authorize URL along with a signed state token that
+// OAuthCallback uses to detect tampering or cross-provider replay.
+//
+//encore:api public method=POST path=/v1/oauth/login
+func (a *API) OAuthLogin(ctx context.Context, p *OAuthLoginParams) (*OAuthRedirectResponse, error) {
+	eb := errs.B().Meta("oauth_login", p.Provider)
+
+	endpoint, ok := oauthEndpoints[p.Provider]
+	if !ok {
+		return nil, eb.Code(errs.InvalidArgument).Msg("unsupported provider").Err()
+	}
+	clientID, _ := oauthClientCredentials(p.Provider)
+	if clientID == "" {
+		return nil, eb.Code(errs.Internal).Msg("provider not configured").Err()
+	}
+	if !redirectURIAllowed(p.Provider, p.RedirectURI) {
+		return nil, eb.Code(errs.InvalidArgument).Msg("redirect_uri not allowed").Err()
+	}
+
+	state, err := security.NewStateToken(string(p.Provider), p.RedirectURI)
+	if err != nil {
+		return nil, eb.Code(errs.Internal).Msg("internal error").Err()
+	}
+
+	q := url.Values{}
+	q.Set("client_id", clientID)
+	q.Set("redirect_uri", p.RedirectURI)
+	q.Set("scope", endpoint.scope)
+	q.Set("state", state)
+	q.Set("response_type", "code")
+
+	return &OAuthRedirectResponse{
+		AuthorizeURL: endpoint.authURL + "?" + q.Encode(),
+		State:        state,
+	}, nil
+}
+
+// OAuthCallbackParams are the parameters to the OAuthCallback method
+type OAuthCallbackParams struct {
+	Provider  OAuthProvider `json:"provider"`
+	Code      string        `json:"code"`
+	State     string        `json:"state"`
+	UserAgent string        `header:"User-Agent"`
+}
+
+// OAuthCallback exchanges the provider's authorization code, fetches the user's profile, and
+// either links it to an existing user by email or auto-provisions a new one.
+//
+//encore:api public method=POST path=/v1/oauth/callback
+func (a *API) OAuthCallback(ctx context.Context, p *OAuthCallbackParams) (*AuthResponse, error) {
+	eb := errs.B().Meta("oauth_callback", p.Provider)
+
+	redirectURI, err := security.ParseStateToken(p.State, string(p.Provider))
+	if err != nil {
+		return nil, eb.Code(errs.Unauthenticated).Msg("invalid state").Err()
+	}
+	if !redirectURIAllowed(p.Provider, redirectURI) {
+		return nil, eb.Code(errs.InvalidArgument).Msg("redirect_uri not allowed").Err()
+	}
+
+	endpoint, ok := oauthEndpoints[p.Provider]
+	if !ok {
+		return nil, eb.Code(errs.InvalidArgument).Msg("unsupported provider").Err()
+	}
+	clientID, clientSecret := oauthClientCredentials(p.Provider)
+
+	accessToken, err := exchangeOAuthCode(ctx, endpoint, clientID, clientSecret, p.Code, redirectURI)
+	if err != nil {
+		return nil, eb.Code(errs.Unauthenticated).Msg("could not exchange code").Err()
+	}
+
+	identity, err := fetchOAuthUserInfo(ctx, p.Provider, endpoint, accessToken)
+	if err != nil {
+		return nil, eb.Code(errs.Unauthenticated).Msg("could not fetch user info").Err()
+	}
+	if !identity.emailVerified {
+		return nil, eb.Code(errs.PermissionDenied).Msg("provider did not confirm email ownership").Err()
+	}
+
+	email, err := a.Service.LinkOrCreateIdentity(ctx, string(p.Provider), identity.subject, identity.email)
+	if err != nil {
+		return nil, eb.Code(errs.Internal).Msg("could not link identity").Err()
+	}
+
+	hasTOTP, err := a.Service.HasConfirmedTOTP(ctx, email.String())
+	if err != nil {
+		return nil, eb.Code(errs.Internal).Msg("internal error").Err()
+	}
+	if hasTOTP {
+		challenge, err := security.NewChallengeToken(email.String())
+		if err != nil {
+			return nil, eb.Code(errs.Internal).Msg("internal error").Err()
+		}
+		return &AuthResponse{MFARequired: true, ChallengeToken: challenge}, nil
+	}
+
+	token, err := security.NewToken(email.String())
+	if err != nil {
+		return nil, eb.Code(errs.Internal).Msg("internal error").Err()
+	}
+	_, err = AuthEvents.Publish(ctx, &AuthEvent{UserEmail: email.String()})
+	if err != nil {
+		return nil, eb.Code(errs.Internal).Msg("internal error").Err()
+	}
+	publishUserLoggedIn(ctx, a.Service, email.String(), p.UserAgent)
+	return &AuthResponse{Token: token}, nil
+}
+
+// oauthIdentity is the subset of a provider's userinfo response we care about. emailVerified
+// reflects the provider's own assertion that the account holder controls email, not merely that
+// the address was present on the profile - OAuthCallback refuses to link or create an account
+// from an identity whose email isn't verified.
+type oauthIdentity struct {
+	subject       string
+	email         string
+	emailVerified bool
+}
+
+// googleUserInfo is the response shape of Google's oauth2/v3/userinfo endpoint.
+type googleUserInfo struct {
+	Sub           string `json:"sub"`
+	Email         string `json:"email"`
+	EmailVerified bool   `json:"email_verified"`
+}
+
+// githubUser is the subset of GitHub's /user response decoded here. That response's email is
+// the user's public profile email (often empty or unverified), so only the ID is decoded, as the
+// subject source - the verified address comes from githubEmail via /user/emails.
+type githubUser struct {
+	ID int64 `json:"id"`
+}
+
+// githubEmail is one entry in the response of GitHub's /user/emails endpoint.
+type githubEmail struct {
+	Email    string `json:"email"`
+	Primary  bool   `json:"primary"`
+	Verified bool   `json:"verified"`
+}
+
+// exchangeOAuthCode trades an authorization code for an access token.
+func exchangeOAuthCode(ctx context.Context, endpoint oauthEndpoint, clientID, clientSecret, code, redirectURI string) (string, error) {
+	form := url.Values{}
+	form.Set("client_id", clientID)
+	form.Set("client_secret", clientSecret)
+	form.Set("code", code)
+	form.Set("redirect_uri", redirectURI)
+	form.Set("grant_type", "authorization_code")
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint.tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", fmt.Errorf("could not build token request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("could not reach token endpoint: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("token endpoint returned status %d", resp.StatusCode)
+	}
+
+	var body struct {
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", fmt.Errorf("could not decode token response: %w", err)
+	}
+	if body.AccessToken == "" {
+		return "", fmt.Errorf("token response did not contain an access token")
+	}
+	return body.AccessToken, nil
+}
+
+// fetchOAuthUserInfo fetches the caller's profile from the provider's userinfo endpoint.
+func fetchOAuthUserInfo(ctx context.Context, provider OAuthProvider, endpoint oauthEndpoint, accessToken string) (*oauthIdentity, error) {
+	switch provider {
+	case OAuthProviderGoogle:
+		var info googleUserInfo
+		if err := getOAuthJSON(ctx, endpoint.userInfoURL, accessToken, &info); err != nil {
+			return nil, err
+		}
+		if info.Sub == "" {
+			return nil, fmt.Errorf("userinfo response did not contain a subject")
+		}
+		return &oauthIdentity{
+			subject:       info.Sub,
+			email:         info.Email,
+			emailVerified: info.EmailVerified,
+		}, nil
+	case OAuthProviderGitHub:
+		var u githubUser
+		if err := getOAuthJSON(ctx, endpoint.userInfoURL, accessToken, &u); err != nil {
+			return nil, err
+		}
+		if u.ID == 0 {
+			return nil, fmt.Errorf("userinfo response did not contain an id")
+		}
+
+		var emails []githubEmail
+		if err := getOAuthJSON(ctx, "https://api.github.com/user/emails", accessToken, &emails); err != nil {
+			return nil, err
+		}
+		var verifiedEmail string
+		for _, e := range emails {
+			if e.Primary && e.Verified {
+				verifiedEmail = e.Email
+				break
+			}
+		}
+
+		return &oauthIdentity{
+			subject:       fmt.Sprintf("%d", u.ID),
+			email:         verifiedEmail,
+			emailVerified: verifiedEmail != "",
+		}, nil
+	default:
+		return nil, fmt.Errorf("unsupported provider %q", provider)
+	}
+}
+
+// getOAuthJSON fetches url with the given bearer token and decodes the JSON response into out.
+func getOAuthJSON(ctx context.Context, url, accessToken string, out any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return fmt.Errorf("could not build request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("could not reach %s: %w", url, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned status %d", url, resp.StatusCode)
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("could not decode response from %s: %w", url, err)
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+package user
+
+import (
+	"context"
+
+	"encore.app/user/mail"
+	"encore.app/user/types"
+	"encore.dev/beta/errs"
+	"encore.dev/pubsub"
+)
+
+// PasswordResetEvent carries what a downstream mail service needs to deliver a password reset
+// link.
+type PasswordResetEvent struct {
+	UserEmail string
+	Token     string
+}
+
+// PasswordResetEvents topic
+var PasswordResetEvents = pubsub.NewTopic[*PasswordResetEvent]("password-reset", pubsub.TopicConfig{
+	DeliveryGuarantee: pubsub.AtLeastOnce,
+})
+
+var mailer = mail.New()
+
+// The send-password-reset-email subscription emails the reset token for every
+// PasswordResetEvents message.
+var _ = pubsub.NewSubscription(PasswordResetEvents, "send-password-reset-email", pubsub.SubscriptionConfig[*PasswordResetEvent]{
+	Handler: func(ctx context.Context, event *PasswordResetEvent) error {
+		return mailer.SendPasswordReset(ctx, event.UserEmail, event.Token)
+	},
+})
+
+// RequestPasswordResetParams are the parameters to the RequestPasswordReset method
+type RequestPasswordResetParams struct {
+	Email types.Email `json:"email"`
+}
+
+// RequestPasswordResetResponse is the (always empty) response to RequestPasswordReset. The
+// response is identical whether or not the email belongs to a registered account, to avoid
+// account enumeration.
+type RequestPasswordResetResponse struct{}
+
+// RequestPasswordReset issues a single-use, 30-minute password reset token for email if an
+// account exists for it, and publishes it to PasswordResetEvents for delivery.
+//
+//encore:api public method=POST path=/v1/password-reset/request
+func (a *API) RequestPasswordReset(ctx context.Context, p *RequestPasswordResetParams) (*RequestPasswordResetResponse, error) {
+	eb := errs.B().Meta("request_password_reset", p.Email)
+
+	token, err := a.Service.CreatePasswordReset(ctx, p.Email)
+	if err != nil {
+		return nil, eb.Code(errs.Internal).Msg("internal error").Err()
+	}
+	if token != "" {
+		_, err = PasswordResetEvents.Publish(ctx, &PasswordResetEvent{UserEmail: p.Email.String(), Token: token})
+		if err != nil {
+			return nil, eb.Code(errs.Internal).Msg("internal error").Err()
+		}
+	}
+	return &RequestPasswordResetResponse{}, nil
+}
+
+// ConfirmPasswordResetParams are the parameters to the ConfirmPasswordReset method
+type ConfirmPasswordResetParams struct {
+	Token       string `json:"token"`
+	NewPassword string `json:"new_password"`
+}
+
+// ConfirmPasswordResetResponse is the (empty) response to ConfirmPasswordReset.
+type ConfirmPasswordResetResponse struct{}
+
+// ConfirmPasswordReset sets a new password for the account associated with an unused, unexpired
+// reset token, and invalidates any outstanding session tokens issued before the change.
+//
+//encore:api public method=POST path=/v1/password-reset/confirm
+func (a *API) ConfirmPasswordReset(ctx context.Context, p *ConfirmPasswordResetParams) (*ConfirmPasswordResetResponse, error) {
+	eb := errs.B().Meta("confirm_password_reset")
+
+	if err := a.Service.ConfirmPasswordReset(ctx, p.Token, p.NewPassword); err != nil {
+		return nil, eb.Code(errs.InvalidArgument).Msg("invalid or expired reset token").Err()
+	}
+	return &ConfirmPasswordResetResponse{}, nil
+}
@@ -0,0 +1,120 @@
+package user
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"encore.app/user/types"
+)
+
+const passwordResetTTL = 30 * time.Minute
+
+// CreatePasswordReset issues a new password reset token for the user with the given email, if
+// one exists, and returns the raw token to be emailed to them. It returns an empty token and no
+// error if no account matches email.
+func (s *Service) CreatePasswordReset(ctx context.Context, email types.Email) (string, error) {
+	var userID string
+	err := s.DB.QueryRow(ctx, `select id from users where email = $1`, email.String()).Scan(&userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("could not look up user: %w", err)
+	}
+
+	token, err := newResetToken()
+	if err != nil {
+		return "", fmt.Errorf("could not generate reset token: %w", err)
+	}
+
+	_, err = s.DB.Exec(ctx, `
+        insert into password_resets (token_hash, user_id, expires_at) values ($1, $2, $3)
+    `, hashResetToken(token), userID, time.Now().Add(passwordResetTTL))
+	if err != nil {
+		return "", fmt.Errorf("could not create password reset: %w", err)
+	}
+	return token, nil
+}
+
+// ConfirmPasswordReset validates token and, if it is unused and unexpired, sets the associated
+// user's password to newPassword, marks the token used, and bumps password_changed_at so
+// outstanding session tokens are invalidated.
+func (s *Service) ConfirmPasswordReset(ctx context.Context, token, newPassword string) error {
+	var userID string
+	var expiresAt time.Time
+	var usedAt sql.NullTime
+	err := s.DB.QueryRow(ctx, `
+        select user_id, expires_at, used_at from password_resets where token_hash = $1
+    `, hashResetToken(token)).Scan(&userID, &expiresAt, &usedAt)
+	if err != nil {
+		return fmt.Errorf("invalid reset token: %w", err)
+	}
+	if usedAt.Valid {
+		return fmt.Errorf("reset token already used")
+	}
+	if time.Now().After(expiresAt) {
+		return fmt.Errorf("reset token expired")
+	}
+
+	hash, err := s.Hasher.Hash(newPassword)
+	if err != nil {
+		return fmt.Errorf("could not hash password: %w", err)
+	}
+
+	tx, err := s.DB.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("could not start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(ctx, `
+        update users set password = $1, password_changed_at = now() where id = $2
+    `, hash, userID); err != nil {
+		return fmt.Errorf("could not update password: %w", err)
+	}
+	if _, err := tx.Exec(ctx, `
+        update password_resets set used_at = now() where token_hash = $1
+    `, hashResetToken(token)); err != nil {
+		return fmt.Errorf("could not mark reset token used: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("could not commit transaction: %w", err)
+	}
+	return nil
+}
+
+// IsTokenValidForEmail reports whether a session token issued at iat is still valid for the
+// user with the given email, i.e. it was issued after their password was last changed (if
+// ever).
+func (s *Service) IsTokenValidForEmail(ctx context.Context, email string, iat int64) (bool, error) {
+	var passwordChangedAt sql.NullTime
+	err := s.DB.QueryRow(ctx, `
+        select password_changed_at from users where email = $1
+    `, email).Scan(&passwordChangedAt)
+	if err != nil {
+		return false, fmt.Errorf("could not look up user: %w", err)
+	}
+	if !passwordChangedAt.Valid {
+		return true, nil
+	}
+	return time.Unix(iat, 0).After(passwordChangedAt.Time), nil
+}
+
+func newResetToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("could not generate token: %w", err)
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+func hashResetToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,60 @@
+package user
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"encore.app/user/types"
+	"github.com/google/uuid"
+)
+
+// TestPasswordReset_ConfirmInvalidatesSessionsAndToken exercises the full reset flow: a token
+// from CreatePasswordReset resets the password exactly once and bumps password_changed_at so
+// IsTokenValidForEmail rejects tokens issued before the reset.
+func TestPasswordReset_ConfirmInvalidatesSessionsAndToken(t *testing.T) {
+	ctx := context.Background()
+	s := NewService(db)
+
+	email, _ := types.NewEmail(fmt.Sprintf("reset-%s@example.com", uuid.New().String()))
+	if err := s.CreateUser(ctx, email, "original-password", "Test", "User"); err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+
+	oldTokenIssuedAt := time.Now().Unix()
+
+	token, err := s.CreatePasswordReset(ctx, email)
+	if err != nil {
+		t.Fatalf("CreatePasswordReset: %v", err)
+	}
+	if token == "" {
+		t.Fatal("CreatePasswordReset: expected a non-empty token for an existing user")
+	}
+
+	if err := s.ConfirmPasswordReset(ctx, token, "new-password"); err != nil {
+		t.Fatalf("ConfirmPasswordReset: %v", err)
+	}
+
+	// The token is single-use.
+	if err := s.ConfirmPasswordReset(ctx, token, "another-password"); err == nil {
+		t.Fatal("ConfirmPasswordReset: reused token should be rejected")
+	}
+
+	// The new password verifies; the old one no longer does.
+	if err := s.ValidateUser(ctx, email, "new-password"); err != nil {
+		t.Fatalf("ValidateUser with new password: %v", err)
+	}
+	if err := s.ValidateUser(ctx, email, "original-password"); err == nil {
+		t.Fatal("ValidateUser with old password should fail after reset")
+	}
+
+	// A session token issued before the reset is no longer valid for this email.
+	valid, err := s.IsTokenValidForEmail(ctx, email.String(), oldTokenIssuedAt)
+	if err != nil {
+		t.Fatalf("IsTokenValidForEmail: %v", err)
+	}
+	if valid {
+		t.Fatal("IsTokenValidForEmail: token issued before the reset should be invalidated")
+	}
+}
@@ -0,0 +1,195 @@
+package security
+
+import (
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// legacySHA1Prefix tags rows that still hold an unsalted SHA1 hash from before PasswordHasher
+// was introduced, so ValidatePassword can detect and transparently upgrade them.
+const legacySHA1Prefix = "sha1:"
+
+// PasswordHasher hashes and verifies passwords, and reports whether a stored hash should be
+// transparently upgraded to the current algorithm or cost.
+type PasswordHasher interface {
+	Hash(password string) (string, error)
+	Verify(password, hash string) (bool, error)
+	NeedsRehash(hash string) bool
+}
+
+// IsLegacySHA1 reports whether hash is a pre-PasswordHasher SHA1 value tagged by the
+// sha1-prefix migration.
+func IsLegacySHA1(hash string) bool {
+	return strings.HasPrefix(hash, legacySHA1Prefix)
+}
+
+// VerifyLegacySHA1 verifies password against a tagged legacy sha1 hash.
+func VerifyLegacySHA1(password, hash string) bool {
+	sum := sha1.Sum([]byte(password))
+	want := legacySHA1Prefix + hex.EncodeToString(sum[:])
+	return subtle.ConstantTimeCompare([]byte(hash), []byte(want)) == 1
+}
+
+// VerifyPassword verifies password against hash, dispatching on hash's own prefix rather than
+// the currently-configured PasswordHasher. This is what makes the hash format prefix useful:
+// bcrypt-hashed users keep working after PasswordAlgorithm is switched to argon2id (or back),
+// since each hash is verified with the algorithm that actually produced it.
+func VerifyPassword(password, hash string) (bool, error) {
+	switch {
+	case IsLegacySHA1(hash):
+		return VerifyLegacySHA1(password, hash), nil
+	case strings.HasPrefix(hash, "$argon2id$"):
+		return (&argon2Hasher{}).Verify(password, hash)
+	case strings.HasPrefix(hash, "$2a$"), strings.HasPrefix(hash, "$2b$"), strings.HasPrefix(hash, "$2y$"):
+		return (&bcryptHasher{}).Verify(password, hash)
+	default:
+		return false, fmt.Errorf("unrecognized password hash format")
+	}
+}
+
+// NeedsRehash reports whether hash should be replaced with one produced by the given
+// PasswordHasher: because it's a legacy SHA1 hash, because it uses a different algorithm than
+// the hasher, or because the hasher's own parameters (e.g. bcrypt cost) have since changed.
+func NeedsRehash(hasher PasswordHasher, hash string) bool {
+	if IsLegacySHA1(hash) {
+		return true
+	}
+	switch hasher.(type) {
+	case *argon2Hasher:
+		if !strings.HasPrefix(hash, "$argon2id$") {
+			return true
+		}
+	case *bcryptHasher:
+		if !strings.HasPrefix(hash, "$2a$") && !strings.HasPrefix(hash, "$2b$") && !strings.HasPrefix(hash, "$2y$") {
+			return true
+		}
+	}
+	return hasher.NeedsRehash(hash)
+}
+
+// bcryptHasher is the default PasswordHasher.
+type bcryptHasher struct {
+	cost int
+}
+
+// NewBcryptHasher returns a PasswordHasher backed by bcrypt at the given cost. A cost of 0
+// uses bcrypt.DefaultCost.
+func NewBcryptHasher(cost int) PasswordHasher {
+	if cost == 0 {
+		cost = bcrypt.DefaultCost
+	}
+	return &bcryptHasher{cost: cost}
+}
+
+func (h *bcryptHasher) Hash(password string) (string, error) {
+	b, err := bcrypt.GenerateFromPassword([]byte(password), h.cost)
+	if err != nil {
+		return "", fmt.Errorf("could not hash password: %w", err)
+	}
+	return string(b), nil
+}
+
+func (h *bcryptHasher) Verify(password, hash string) (bool, error) {
+	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+	if err != nil {
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			return false, nil
+		}
+		return false, fmt.Errorf("could not verify password: %w", err)
+	}
+	return true, nil
+}
+
+func (h *bcryptHasher) NeedsRehash(hash string) bool {
+	cost, err := bcrypt.Cost([]byte(hash))
+	if err != nil {
+		return true
+	}
+	return cost != h.cost
+}
+
+// argon2Params are the tunable argon2id parameters, encoded alongside the hash so they can
+// change over time without invalidating already-issued hashes.
+type argon2Params struct {
+	memory      uint32
+	iterations  uint32
+	parallelism uint8
+}
+
+var defaultArgon2Params = argon2Params{memory: 64 * 1024, iterations: 1, parallelism: 2}
+
+// argon2Hasher is the alternative PasswordHasher, selected via Encore config.
+type argon2Hasher struct {
+	params argon2Params
+}
+
+// NewArgon2Hasher returns a PasswordHasher backed by argon2id with sensible default parameters.
+func NewArgon2Hasher() PasswordHasher {
+	return &argon2Hasher{params: defaultArgon2Params}
+}
+
+const argon2KeyLength = 32
+
+func (h *argon2Hasher) Hash(password string) (string, error) {
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return "", fmt.Errorf("could not generate salt: %w", err)
+	}
+	key := argon2.IDKey([]byte(password), salt, h.params.iterations, h.params.memory, h.params.parallelism, argon2KeyLength)
+	encoded := fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, h.params.memory, h.params.iterations, h.params.parallelism,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	)
+	return encoded, nil
+}
+
+func (h *argon2Hasher) Verify(password, hash string) (bool, error) {
+	params, salt, key, err := decodeArgon2Hash(hash)
+	if err != nil {
+		return false, err
+	}
+	candidate := argon2.IDKey([]byte(password), salt, params.iterations, params.memory, params.parallelism, uint32(len(key)))
+	return subtle.ConstantTimeCompare(candidate, key) == 1, nil
+}
+
+func (h *argon2Hasher) NeedsRehash(hash string) bool {
+	params, _, _, err := decodeArgon2Hash(hash)
+	if err != nil {
+		return true
+	}
+	return params != h.params
+}
+
+func decodeArgon2Hash(hash string) (argon2Params, []byte, []byte, error) {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return argon2Params{}, nil, nil, fmt.Errorf("invalid argon2id hash")
+	}
+	var p argon2Params
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil {
+		return argon2Params{}, nil, nil, fmt.Errorf("invalid argon2id version: %w", err)
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &p.memory, &p.iterations, &p.parallelism); err != nil {
+		return argon2Params{}, nil, nil, fmt.Errorf("invalid argon2id params: %w", err)
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return argon2Params{}, nil, nil, fmt.Errorf("invalid argon2id salt: %w", err)
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return argon2Params{}, nil, nil, fmt.Errorf("invalid argon2id hash: %w", err)
+	}
+	return p, salt, key, nil
+}
@@ -0,0 +1,44 @@
+package security
+
+import "testing"
+
+// TestVerifyPassword_LegacySHA1Upgrade exercises the upgrade path ValidatePassword relies on: a
+// legacy sha1-prefixed hash verifies once against VerifyPassword, NeedsRehash reports that it
+// should be replaced, and the hash produced by rehashing verifies (and no longer needs rehashing)
+// under the same hasher.
+func TestVerifyPassword_LegacySHA1Upgrade(t *testing.T) {
+	const password = "correct horse battery staple"
+	legacyHash := legacySHA1Prefix + "abf7aad6438836dbe526aa231abde2d0eef74d42"
+
+	ok, err := VerifyPassword(password, legacyHash)
+	if err != nil {
+		t.Fatalf("VerifyPassword returned error: %v", err)
+	}
+	if !ok {
+		t.Fatal("VerifyPassword: legacy sha1 hash did not verify")
+	}
+
+	hasher := NewBcryptHasher(bcryptCostForTest)
+	if !NeedsRehash(hasher, legacyHash) {
+		t.Fatal("NeedsRehash: legacy sha1 hash should always need rehashing")
+	}
+
+	upgraded, err := hasher.Hash(password)
+	if err != nil {
+		t.Fatalf("Hash returned error: %v", err)
+	}
+
+	ok, err = VerifyPassword(password, upgraded)
+	if err != nil {
+		t.Fatalf("VerifyPassword returned error for upgraded hash: %v", err)
+	}
+	if !ok {
+		t.Fatal("VerifyPassword: upgraded hash did not verify")
+	}
+	if NeedsRehash(hasher, upgraded) {
+		t.Fatal("NeedsRehash: freshly upgraded hash should not need rehashing again")
+	}
+}
+
+// bcryptCostForTest keeps the test fast while still exercising a real bcrypt hash.
+const bcryptCostForTest = 4
@@ -0,0 +1,98 @@
+// Package security holds the cryptographic building blocks for the user service: session and
+// challenge tokens, password hashing, and TOTP.
+package security
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var secrets struct {
+	JWTSecret string
+}
+
+// NewToken creates a new signed session token for the given email.
+func NewToken(email string) (string, error) {
+	claims := jwt.MapClaims{
+		"email": email,
+		"iat":   time.Now().Unix(),
+		"exp":   time.Now().Add(24 * time.Hour).Unix(),
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	signed, err := token.SignedString([]byte(secrets.JWTSecret))
+	if err != nil {
+		return "", fmt.Errorf("could not sign token: %w", err)
+	}
+	return signed, nil
+}
+
+// ParseToken parses and validates a signed token.
+func ParseToken(tokenString string) (*jwt.Token, error) {
+	token, err := jwt.Parse(tokenString, func(t *jwt.Token) (interface{}, error) {
+		if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", t.Header["alg"])
+		}
+		return []byte(secrets.JWTSecret), nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not parse token: %w", err)
+	}
+	if !token.Valid {
+		return nil, fmt.Errorf("invalid token")
+	}
+	return token, nil
+}
+
+// challengeTokenTTL is deliberately short: the challenge token only needs to survive the brief
+// window between Auth and AuthTOTP.
+const challengeTokenTTL = 2 * time.Minute
+
+// NewChallengeToken creates a short-lived signed token for email, used to complete a login that
+// Auth deferred pending a TOTP challenge. It carries a "purpose" claim so it cannot be used as a
+// regular session bearer token.
+func NewChallengeToken(email string) (string, error) {
+	claims := jwt.MapClaims{
+		"email":   email,
+		"purpose": "mfa_challenge",
+		"iat":     time.Now().Unix(),
+		"exp":     time.Now().Add(challengeTokenTTL).Unix(),
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	signed, err := token.SignedString([]byte(secrets.JWTSecret))
+	if err != nil {
+		return "", fmt.Errorf("could not sign challenge token: %w", err)
+	}
+	return signed, nil
+}
+
+// ParseChallengeToken validates a token issued by NewChallengeToken and returns the email it
+// was issued for.
+func ParseChallengeToken(tokenString string) (string, error) {
+	token, err := ParseToken(tokenString)
+	if err != nil {
+		return "", fmt.Errorf("invalid challenge token: %w", err)
+	}
+	claims, err := GetClaims(token)
+	if err != nil {
+		return "", err
+	}
+	if claims["purpose"] != "mfa_challenge" {
+		return "", fmt.Errorf("not a challenge token")
+	}
+	email, _ := claims["email"].(string)
+	if email == "" {
+		return "", fmt.Errorf("challenge token missing email")
+	}
+	return email, nil
+}
+
+// GetClaims extracts the claims from a parsed token.
+func GetClaims(token *jwt.Token) (jwt.MapClaims, error) {
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return nil, fmt.Errorf("invalid claims")
+	}
+	return claims, nil
+}
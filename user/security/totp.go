@@ -0,0 +1,99 @@
+package security
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	totpDigits    = 6
+	totpStep      = 30 * time.Second
+	totpSkewSteps = 1
+	totpIssuer    = "Monetz"
+)
+
+var base32Encoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// NewTOTPSecret generates a new base32-encoded TOTP secret.
+func NewTOTPSecret() (string, error) {
+	raw := make([]byte, 20)
+	if _, err := rand.Read(raw); err != nil {
+		return "", fmt.Errorf("could not generate totp secret: %w", err)
+	}
+	return base32Encoding.EncodeToString(raw), nil
+}
+
+// TOTPURI builds the otpauth:// URI for secret and account, for QR code rendering by the client.
+func TOTPURI(secret, account string) string {
+	v := url.Values{}
+	v.Set("secret", secret)
+	v.Set("issuer", totpIssuer)
+	v.Set("algorithm", "SHA1")
+	v.Set("digits", fmt.Sprint(totpDigits))
+	v.Set("period", fmt.Sprint(int(totpStep.Seconds())))
+	return fmt.Sprintf("otpauth://totp/%s:%s?%s", totpIssuer, account, v.Encode())
+}
+
+// ValidateTOTP reports whether code is a valid TOTP code for secret, allowing ±1 step of clock
+// skew (RFC 6238, 30-second step, SHA1 HMAC).
+func ValidateTOTP(secret, code string) bool {
+	code = strings.TrimSpace(code)
+	now := time.Now()
+	for skew := -totpSkewSteps; skew <= totpSkewSteps; skew++ {
+		if generateTOTP(secret, now.Add(time.Duration(skew)*totpStep)) == code {
+			return true
+		}
+	}
+	return false
+}
+
+func generateTOTP(secret string, t time.Time) string {
+	key, err := base32Encoding.DecodeString(strings.ToUpper(secret))
+	if err != nil {
+		return ""
+	}
+	counter := uint64(t.Unix()) / uint64(totpStep.Seconds())
+
+	buf := make([]byte, 8)
+	binary.BigEndian.PutUint64(buf, counter)
+
+	mac := hmac.New(sha1.New, key)
+	mac.Write(buf)
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	truncated := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	code := truncated % uint32(math.Pow10(totpDigits))
+	return fmt.Sprintf("%0*d", totpDigits, code)
+}
+
+// NewRecoveryCode generates a random single-use TOTP recovery code.
+func NewRecoveryCode() (string, error) {
+	buf := make([]byte, 5)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("could not generate recovery code: %w", err)
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// HashRecoveryCode hashes a recovery code for storage.
+func HashRecoveryCode(code string) string {
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
+
+// VerifyRecoveryCode reports whether code matches a stored recovery code hash.
+func VerifyRecoveryCode(code, hash string) bool {
+	return subtle.ConstantTimeCompare([]byte(HashRecoveryCode(code)), []byte(hash)) == 1
+}
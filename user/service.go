@@ -2,40 +2,69 @@ package user
 
 import (
 	"context"
-	"crypto/sha1"
 	"fmt"
 
+	"encore.app/user/security"
+	"encore.app/user/types"
 	"encore.dev/storage/sqldb"
 	"github.com/google/uuid"
 )
 
+// User represents a row in the users table.
+type User struct {
+	ID        string
+	Email     types.Email
+	Password  string
+	FirstName string
+	LastName  string
+}
+
 // UseCase is user logic interface
 type UseCase interface {
-	ValidateUser(ctx context.Context, email, password string) error
+	ValidateUser(ctx context.Context, email types.Email, password string) error
 	ValidatePassword(ctx context.Context, u *User, password string) error
-	CreateUser(ctx context.Context, email, password, firstName, lastName string) error
-	UserExists(ctx context.Context, email string) (bool, error)
+	CreateUser(ctx context.Context, email types.Email, password, firstName, lastName string) error
+	UserExists(ctx context.Context, email types.Email) (bool, error)
+	LinkOrCreateIdentity(ctx context.Context, provider, subject, email string) (types.Email, error)
+	StageTOTPSecret(ctx context.Context, email, secret string) error
+	ConfirmTOTP(ctx context.Context, email, code string) ([]string, error)
+	HasConfirmedTOTP(ctx context.Context, email string) (bool, error)
+	ValidateTOTPChallenge(ctx context.Context, email, code string) error
+	CreatePasswordReset(ctx context.Context, email types.Email) (string, error)
+	ConfirmPasswordReset(ctx context.Context, token, newPassword string) error
+	IsTokenValidForEmail(ctx context.Context, email string, iat int64) (bool, error)
+	AuditActor(ctx context.Context, email string) (*AuditActor, error)
 }
 
 // Service is the service for the user package
 type Service struct {
-	DB *sqldb.Database
+	DB     *sqldb.Database
+	Hasher security.PasswordHasher
 }
 
 // NewService creates a new user service
 func NewService(db *sqldb.Database) *Service {
-	return &Service{DB: db}
+	return &Service{DB: db, Hasher: newConfiguredHasher()}
+}
+
+func newConfiguredHasher() security.PasswordHasher {
+	if cfg.PasswordAlgorithm() == "argon2id" {
+		return security.NewArgon2Hasher()
+	}
+	return security.NewBcryptHasher(cfg.BcryptCost())
 }
 
-// ValidateUser validates a user
-func (s *Service) ValidateUser(ctx context.Context, email, password string) error {
+// ValidateUser validates a user's credentials.
+func (s *Service) ValidateUser(ctx context.Context, email types.Email, password string) error {
 	var u User
+	var rowEmail string
 	err := s.DB.QueryRow(ctx, `
         select id, email, password, first_name, last_name from users where email = $1
-    `, email).Scan(&u.ID, &u.Email, &u.Password, &u.FirstName, &u.LastName)
+    `, email.String()).Scan(&u.ID, &rowEmail, &u.Password, &u.FirstName, &u.LastName)
 	if err != nil {
 		return fmt.Errorf("invalid user %w", err)
 	}
+	u.Email = types.Email(rowEmail)
 	err = s.ValidatePassword(ctx, &u, password)
 	if err != nil {
 		return fmt.Errorf("invalid user")
@@ -43,29 +72,65 @@ func (s *Service) ValidateUser(ctx context.Context, email, password string) erro
 	return nil
 }
 
-// ValidatePassword validates a password
+// ValidatePassword validates password against u's stored hash. The hash's own prefix selects
+// the algorithm used to verify it, so this keeps working regardless of which PasswordHasher is
+// currently configured. A legacy SHA1 hash that verifies successfully is transparently rehashed
+// with the current algorithm; a hash that verifies but was hashed with stale parameters or a
+// different algorithm is rehashed as well.
 func (s *Service) ValidatePassword(ctx context.Context, u *User, password string) error {
-	h := sha1.New()
-	h.Write([]byte(password))
-	p := fmt.Sprintf("%x", h.Sum(nil))
-	if p != u.Password {
+	ok, err := security.VerifyPassword(password, u.Password)
+	if err != nil {
+		return fmt.Errorf("could not verify password: %w", err)
+	}
+	if !ok {
 		return fmt.Errorf("invalid password")
 	}
+
+	if security.NeedsRehash(s.Hasher, u.Password) {
+		if err := s.upgradePassword(ctx, u, password); err != nil {
+			return fmt.Errorf("could not upgrade password: %w", err)
+		}
+	}
+	return nil
+}
+
+// upgradePassword rehashes password with the current PasswordHasher and persists it, replacing
+// whatever legacy or stale hash u.Password currently holds.
+func (s *Service) upgradePassword(ctx context.Context, u *User, password string) error {
+	hash, err := s.Hasher.Hash(password)
+	if err != nil {
+		return fmt.Errorf("could not hash password: %w", err)
+	}
+
+	tx, err := s.DB.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("could not start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(ctx, `update users set password = $1 where id = $2`, hash, u.ID); err != nil {
+		return fmt.Errorf("could not update password: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("could not commit transaction: %w", err)
+	}
+	u.Password = hash
 	return nil
 }
 
 // CreateUser creates a new user
-func (s *Service) CreateUser(ctx context.Context, email, password, firstName, lastName string) error {
-	h := sha1.New()
-	h.Write([]byte(password))
-	hashedPassword := fmt.Sprintf("%x", h.Sum(nil))
+func (s *Service) CreateUser(ctx context.Context, email types.Email, password, firstName, lastName string) error {
+	hashedPassword, err := s.Hasher.Hash(password)
+	if err != nil {
+		return fmt.Errorf("could not hash password: %w", err)
+	}
 
 	// Generate a new UUID for the user ID
 	userID := uuid.New().String()
 
-	_, err := s.DB.Exec(ctx, `
+	_, err = s.DB.Exec(ctx, `
         insert into users (id, email, password, first_name, last_name) values ($1, $2, $3, $4, $5)
-    `, userID, email, hashedPassword, firstName, lastName)
+    `, userID, email.String(), hashedPassword, firstName, lastName)
 	if err != nil {
 		return fmt.Errorf("could not create user: %w", err)
 	}
@@ -73,11 +138,11 @@ func (s *Service) CreateUser(ctx context.Context, email, password, firstName, la
 }
 
 // UserExists checks if a user with the given email already exists
-func (s *Service) UserExists(ctx context.Context, email string) (bool, error) {
+func (s *Service) UserExists(ctx context.Context, email types.Email) (bool, error) {
 	var exists bool
 	err := s.DB.QueryRow(ctx, `
         select exists(select 1 from users where email = $1)
-    `, email).Scan(&exists)
+    `, email.String()).Scan(&exists)
 	if err != nil {
 		return false, fmt.Errorf("could not check if user exists: %w", err)
 	}
@@ -0,0 +1,105 @@
+package user
+
+import (
+	"context"
+	"errors"
+
+	"encore.app/user/security"
+	"encore.dev/beta/auth"
+	"encore.dev/beta/errs"
+)
+
+// EnrollTOTPResponse is the response to the EnrollTOTP method
+type EnrollTOTPResponse struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"`
+}
+
+// EnrollTOTP generates a new TOTP secret for the calling user, stages it unconfirmed, and
+// returns it along with an otpauth:// URI for QR rendering. The enrollment only takes effect
+// once the caller proves possession of the secret via ConfirmTOTP.
+//
+//encore:api auth method=POST path=/v1/totp/enroll
+func (a *API) EnrollTOTP(ctx context.Context) (*EnrollTOTPResponse, error) {
+	data, ok := auth.Data().(*AuthData)
+	if !ok {
+		return nil, errs.B().Code(errs.Unauthenticated).Msg("invalid session").Err()
+	}
+	eb := errs.B().Meta("enroll_totp", data.Email)
+
+	secret, err := security.NewTOTPSecret()
+	if err != nil {
+		return nil, eb.Code(errs.Internal).Msg("internal error").Err()
+	}
+	if err := a.Service.StageTOTPSecret(ctx, data.Email, secret); err != nil {
+		return nil, eb.Code(errs.Internal).Msg("internal error").Err()
+	}
+
+	return &EnrollTOTPResponse{
+		Secret: secret,
+		URI:    security.TOTPURI(secret, data.Email),
+	}, nil
+}
+
+// ConfirmTOTPParams are the parameters to the ConfirmTOTP method
+type ConfirmTOTPParams struct {
+	Code string `json:"code"`
+}
+
+// ConfirmTOTPResponse is the response to the ConfirmTOTP method
+type ConfirmTOTPResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+// ConfirmTOTP verifies code against the pending enrollment created by EnrollTOTP. On success the
+// enrollment is confirmed and ten single-use recovery codes are generated and returned; after
+// this point Auth will require a TOTP challenge for this user.
+//
+//encore:api auth method=POST path=/v1/totp/confirm
+func (a *API) ConfirmTOTP(ctx context.Context, p *ConfirmTOTPParams) (*ConfirmTOTPResponse, error) {
+	data, ok := auth.Data().(*AuthData)
+	if !ok {
+		return nil, errs.B().Code(errs.Unauthenticated).Msg("invalid session").Err()
+	}
+	eb := errs.B().Meta("confirm_totp", data.Email)
+
+	codes, err := a.Service.ConfirmTOTP(ctx, data.Email, p.Code)
+	if err != nil {
+		return nil, eb.Code(errs.Unauthenticated).Msg("invalid code").Err()
+	}
+	return &ConfirmTOTPResponse{RecoveryCodes: codes}, nil
+}
+
+// AuthTOTPParams are the parameters to the AuthTOTP method
+type AuthTOTPParams struct {
+	ChallengeToken string `json:"challenge_token"`
+	Code           string `json:"code"`
+	UserAgent      string `header:"User-Agent"`
+}
+
+// AuthTOTP completes a login that Auth deferred pending a TOTP challenge, accepting either a
+// current TOTP code or one of the user's recovery codes.
+//
+//encore:api public method=POST path=/v1/auth/totp
+func (a *API) AuthTOTP(ctx context.Context, p *AuthTOTPParams) (*AuthResponse, error) {
+	eb := errs.B().Meta("auth_totp")
+
+	email, err := security.ParseChallengeToken(p.ChallengeToken)
+	if err != nil {
+		return nil, eb.Code(errs.Unauthenticated).Msg("invalid or expired challenge").Err()
+	}
+
+	if err := a.Service.ValidateTOTPChallenge(ctx, email, p.Code); err != nil {
+		if errors.Is(err, ErrTOTPLocked) {
+			return nil, eb.Code(errs.ResourceExhausted).Msg("too many failed attempts, try again later").Err()
+		}
+		return nil, eb.Code(errs.Unauthenticated).Msg("invalid code").Err()
+	}
+
+	token, err := security.NewToken(email)
+	if err != nil {
+		return nil, eb.Code(errs.Internal).Msg("internal error").Err()
+	}
+	publishUserLoggedIn(ctx, a.Service, email, p.UserAgent)
+	return &AuthResponse{Token: token}, nil
+}
@@ -0,0 +1,181 @@
+package user
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"encore.app/user/security"
+	"github.com/lib/pq"
+)
+
+// ErrTOTPLocked is returned by ValidateTOTPChallenge when the enrollment is locked out after
+// too many failed attempts.
+var ErrTOTPLocked = errors.New("totp challenge locked, try again later")
+
+const totpRecoveryCodeCount = 10
+
+// maxTOTPAttempts is how many consecutive failed codes (TOTP or recovery) a challenge tolerates
+// before locking the enrollment out for totpLockoutWindow, closing the brute-force window a bare
+// 6-digit code search would otherwise leave open.
+const (
+	maxTOTPAttempts   = 5
+	totpLockoutWindow = 15 * time.Minute
+)
+
+// StageTOTPSecret persists a pending (unconfirmed) TOTP secret for the user with the given
+// email, replacing any previous enrollment. A previously confirmed enrollment is replaced as
+// well and stays unconfirmed until ConfirmTOTP succeeds for the new secret.
+func (s *Service) StageTOTPSecret(ctx context.Context, email, secret string) error {
+	userID, err := s.userIDByEmail(ctx, email)
+	if err != nil {
+		return err
+	}
+	_, err = s.DB.Exec(ctx, `
+        insert into user_totp (user_id, secret, recovery_codes)
+        values ($1, $2, '{}')
+        on conflict (user_id) do update set secret = excluded.secret, confirmed_at = null, recovery_codes = '{}'
+    `, userID, secret)
+	if err != nil {
+		return fmt.Errorf("could not stage totp secret: %w", err)
+	}
+	return nil
+}
+
+// ConfirmTOTP verifies code against the user's pending TOTP secret and, on success, confirms the
+// enrollment and returns freshly generated recovery codes.
+func (s *Service) ConfirmTOTP(ctx context.Context, email, code string) ([]string, error) {
+	userID, err := s.userIDByEmail(ctx, email)
+	if err != nil {
+		return nil, err
+	}
+
+	var secret string
+	err = s.DB.QueryRow(ctx, `
+        select secret from user_totp where user_id = $1 and confirmed_at is null
+    `, userID).Scan(&secret)
+	if err != nil {
+		return nil, fmt.Errorf("no pending totp enrollment: %w", err)
+	}
+	if !security.ValidateTOTP(secret, code) {
+		return nil, fmt.Errorf("invalid totp code")
+	}
+
+	codes, hashes, err := generateRecoveryCodes(totpRecoveryCodeCount)
+	if err != nil {
+		return nil, fmt.Errorf("could not generate recovery codes: %w", err)
+	}
+
+	_, err = s.DB.Exec(ctx, `
+        update user_totp set confirmed_at = now(), recovery_codes = $1 where user_id = $2
+    `, pq.Array(hashes), userID)
+	if err != nil {
+		return nil, fmt.Errorf("could not confirm totp: %w", err)
+	}
+	return codes, nil
+}
+
+// HasConfirmedTOTP reports whether the user has a confirmed TOTP enrollment.
+func (s *Service) HasConfirmedTOTP(ctx context.Context, email string) (bool, error) {
+	var exists bool
+	err := s.DB.QueryRow(ctx, `
+        select exists(
+            select 1 from user_totp ut join users u on u.id = ut.user_id
+            where u.email = $1 and ut.confirmed_at is not null
+        )
+    `, email).Scan(&exists)
+	if err != nil {
+		return false, fmt.Errorf("could not check totp enrollment: %w", err)
+	}
+	return exists, nil
+}
+
+// ValidateTOTPChallenge validates a TOTP code or single-use recovery code for email, consuming
+// the recovery code if that's what matched. Failed attempts are counted per enrollment; once
+// maxTOTPAttempts are exhausted the challenge is locked out for totpLockoutWindow regardless of
+// whether subsequent codes would have been correct.
+func (s *Service) ValidateTOTPChallenge(ctx context.Context, email, code string) error {
+	userID, err := s.userIDByEmail(ctx, email)
+	if err != nil {
+		return err
+	}
+
+	var secret string
+	var recoveryHashes []string
+	var lockedUntil sql.NullTime
+	err = s.DB.QueryRow(ctx, `
+        select secret, recovery_codes, locked_until from user_totp where user_id = $1 and confirmed_at is not null
+    `, userID).Scan(&secret, pq.Array(&recoveryHashes), &lockedUntil)
+	if err != nil {
+		return fmt.Errorf("no confirmed totp enrollment: %w", err)
+	}
+	if lockedUntil.Valid && time.Now().Before(lockedUntil.Time) {
+		return ErrTOTPLocked
+	}
+
+	if security.ValidateTOTP(secret, code) {
+		if _, err := s.DB.Exec(ctx, `update user_totp set failed_attempts = 0, locked_until = null where user_id = $1`, userID); err != nil {
+			return fmt.Errorf("could not reset totp attempts: %w", err)
+		}
+		return nil
+	}
+
+	for i, h := range recoveryHashes {
+		if security.VerifyRecoveryCode(code, h) {
+			remaining := append(recoveryHashes[:i:i], recoveryHashes[i+1:]...)
+			_, err := s.DB.Exec(ctx, `
+                update user_totp set recovery_codes = $1, failed_attempts = 0, locked_until = null where user_id = $2
+            `, pq.Array(remaining), userID)
+			if err != nil {
+				return fmt.Errorf("could not consume recovery code: %w", err)
+			}
+			return nil
+		}
+	}
+
+	if err := s.recordFailedTOTPAttempt(ctx, userID); err != nil {
+		return err
+	}
+	return fmt.Errorf("invalid totp code")
+}
+
+// recordFailedTOTPAttempt increments the enrollment's failed attempt counter and, once it
+// reaches maxTOTPAttempts, locks the challenge out for totpLockoutWindow and resets the counter
+// so the next window starts fresh. The increment and threshold check happen in a single UPDATE
+// so concurrent failed attempts against the same enrollment serialize on the row instead of all
+// reading the same pre-increment count and undercounting.
+func (s *Service) recordFailedTOTPAttempt(ctx context.Context, userID string) error {
+	_, err := s.DB.Exec(ctx, `
+        update user_totp
+        set failed_attempts = case when failed_attempts + 1 >= $2 then 0 else failed_attempts + 1 end,
+            locked_until = case when failed_attempts + 1 >= $2 then $3 else locked_until end
+        where user_id = $1
+    `, userID, maxTOTPAttempts, time.Now().Add(totpLockoutWindow))
+	if err != nil {
+		return fmt.Errorf("could not record failed totp attempt: %w", err)
+	}
+	return nil
+}
+
+func (s *Service) userIDByEmail(ctx context.Context, email string) (string, error) {
+	var userID string
+	err := s.DB.QueryRow(ctx, `select id from users where email = $1`, email).Scan(&userID)
+	if err != nil {
+		return "", fmt.Errorf("could not find user: %w", err)
+	}
+	return userID, nil
+}
+
+func generateRecoveryCodes(n int) (codes []string, hashes []string, err error) {
+	for i := 0; i < n; i++ {
+		code, err := security.NewRecoveryCode()
+		if err != nil {
+			return nil, nil, err
+		}
+		codes = append(codes, code)
+		hashes = append(hashes, security.HashRecoveryCode(code))
+	}
+	return codes, hashes, nil
+}
@@ -0,0 +1,119 @@
+package user
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"testing"
+	"time"
+
+	"encore.app/user/security"
+	"encore.app/user/types"
+	"github.com/google/uuid"
+)
+
+// totpCodeForTest stands in for an authenticator app: it derives the current RFC 6238 code for
+// secret independently of the security package, so these tests exercise ConfirmTOTP and
+// ValidateTOTPChallenge the way a real client would, rather than asserting against the
+// production code's own intermediate values.
+func totpCodeForTest(t *testing.T, secret string) string {
+	t.Helper()
+	key, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(secret)
+	if err != nil {
+		t.Fatalf("could not decode totp secret: %v", err)
+	}
+	counter := uint64(time.Now().Unix()) / 30
+
+	buf := make([]byte, 8)
+	binary.BigEndian.PutUint64(buf, counter)
+	mac := hmac.New(sha1.New, key)
+	mac.Write(buf)
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	truncated := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	code := truncated % uint32(math.Pow10(6))
+	return fmt.Sprintf("%06d", code)
+}
+
+// enrollTOTPForTest creates a user, stages and confirms a TOTP secret for them, and returns the
+// user's email and recovery codes.
+func enrollTOTPForTest(t *testing.T, ctx context.Context, s *Service) (string, []string) {
+	t.Helper()
+	email := fmt.Sprintf("totp-%s@example.com", uuid.New().String())
+	if err := s.CreateUser(ctx, types.Email(email), "hunter2-hunter2", "Test", "User"); err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+
+	secret, err := security.NewTOTPSecret()
+	if err != nil {
+		t.Fatalf("NewTOTPSecret: %v", err)
+	}
+	if err := s.StageTOTPSecret(ctx, email, secret); err != nil {
+		t.Fatalf("StageTOTPSecret: %v", err)
+	}
+	codes, err := s.ConfirmTOTP(ctx, email, totpCodeForTest(t, secret))
+	if err != nil {
+		t.Fatalf("ConfirmTOTP: %v", err)
+	}
+	return email, codes
+}
+
+// TestValidateTOTPChallenge_RecoveryCodeIsSingleUse confirms a recovery code completes the
+// challenge once and is rejected on any subsequent attempt.
+func TestValidateTOTPChallenge_RecoveryCodeIsSingleUse(t *testing.T) {
+	ctx := context.Background()
+	s := NewService(db)
+	email, codes := enrollTOTPForTest(t, ctx, s)
+
+	if err := s.ValidateTOTPChallenge(ctx, email, codes[0]); err != nil {
+		t.Fatalf("ValidateTOTPChallenge (recovery code): %v", err)
+	}
+	if err := s.ValidateTOTPChallenge(ctx, email, codes[0]); err == nil {
+		t.Fatal("ValidateTOTPChallenge: reused recovery code should be rejected")
+	}
+}
+
+// TestValidateTOTPChallenge_LocksOutAfterMaxAttempts confirms repeated failed codes lock the
+// challenge out, even for a caller who then supplies a correct code.
+func TestValidateTOTPChallenge_LocksOutAfterMaxAttempts(t *testing.T) {
+	ctx := context.Background()
+	s := NewService(db)
+	email, _ := enrollTOTPForTest(t, ctx, s)
+
+	for i := 0; i < maxTOTPAttempts-1; i++ {
+		if err := s.ValidateTOTPChallenge(ctx, email, "000000"); err == nil {
+			t.Fatalf("attempt %d: expected invalid code error", i)
+		}
+	}
+
+	// The attempt that trips the threshold locks the enrollment out.
+	if err := s.ValidateTOTPChallenge(ctx, email, "000000"); err == nil {
+		t.Fatal("expected the threshold-tripping attempt to fail")
+	}
+
+	secret := secretForTest(t, ctx, s, email)
+	if err := s.ValidateTOTPChallenge(ctx, email, totpCodeForTest(t, secret)); !errors.Is(err, ErrTOTPLocked) {
+		t.Fatalf("ValidateTOTPChallenge after lockout = %v, want ErrTOTPLocked even with a correct code", err)
+	}
+}
+
+// secretForTest reads back the enrollment's secret directly so the lockout test can prove a
+// correct code is still rejected while locked.
+func secretForTest(t *testing.T, ctx context.Context, s *Service, email string) string {
+	t.Helper()
+	userID, err := s.userIDByEmail(ctx, email)
+	if err != nil {
+		t.Fatalf("userIDByEmail: %v", err)
+	}
+	var secret string
+	if err := s.DB.QueryRow(ctx, `select secret from user_totp where user_id = $1`, userID).Scan(&secret); err != nil {
+		t.Fatalf("could not read totp secret: %v", err)
+	}
+	return secret
+}
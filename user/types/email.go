@@ -0,0 +1,48 @@
+// Package types holds value types shared across the user service's API and persistence layers.
+package types
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/mail"
+	"strings"
+)
+
+// Email is a canonical email address: lowercased, trimmed, and RFC 5322-valid. Constructing one
+// via NewEmail (or decoding one from JSON) normalizes it so every API handler and database call
+// works from the same representation, regardless of how the caller capitalized or padded it.
+type Email string
+
+// NewEmail normalizes and validates s as an RFC 5322 email address.
+func NewEmail(s string) (Email, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	addr, err := mail.ParseAddress(s)
+	if err != nil {
+		return "", fmt.Errorf("invalid email address: %w", err)
+	}
+	return Email(addr.Address), nil
+}
+
+// String returns the canonical email address.
+func (e Email) String() string {
+	return string(e)
+}
+
+// MarshalJSON implements json.Marshaler.
+func (e Email) MarshalJSON() ([]byte, error) {
+	return json.Marshal(string(e))
+}
+
+// UnmarshalJSON implements json.Unmarshaler, normalizing the decoded address.
+func (e *Email) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	email, err := NewEmail(s)
+	if err != nil {
+		return err
+	}
+	*e = email
+	return nil
+}